@@ -0,0 +1,161 @@
+package rpc
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"strings"
+
+	"github.com/gobwas/httphead"
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+)
+
+const permessageDeflate = "permessage-deflate"
+
+// negotiatePermessageDeflate reports whether opt is the permessage-deflate
+// extension (RFC 7692), compression is enabled via
+// WithWebSocketCompression, and opt carries no parameters. ws.HTTPUpgrader
+// echoes opt back to the client unchanged when this returns true, and
+// deflateWriter/deflateReader only implement the no-parameter default
+// (context-takeover kept in both directions), so an offer asking for
+// anything else (server_no_context_takeover, *_max_window_bits, ...) is
+// refused rather than agreed to and then ignored.
+func negotiatePermessageDeflate(opts Options, opt httphead.Option) bool {
+	if opts.CompressionLevel <= 0 || !strings.EqualFold(string(opt.Name), permessageDeflate) {
+		return false
+	}
+	return opt.Parameters.Size() == 0
+}
+
+// deflateWriter compresses outgoing websocket message payloads with
+// context-takeover: the flate.Writer, and the LZ77 window it carries, is
+// reused across every message on the connection instead of being reset
+// per frame, so later messages can reference data sent in earlier ones.
+type deflateWriter struct {
+	out bytes.Buffer
+	fw  *flate.Writer
+}
+
+func newDeflateWriter(level int) *deflateWriter {
+	d := &deflateWriter{}
+	d.fw, _ = flate.NewWriter(&d.out, level)
+	return d
+}
+
+// syncFlushMarker is the empty stored block flate.Writer.Flush emits;
+// RFC 7692 section 7.2.1 requires the sender to trim it from the wire,
+// the peer's inflater re-appends it before reading each message.
+var syncFlushMarker = []byte{0, 0, 0xff, 0xff}
+
+// compress deflates p and strips the trailing sync-flush marker.
+func (d *deflateWriter) compress(p []byte) ([]byte, error) {
+	d.out.Reset()
+	if _, err := d.fw.Write(p); err != nil {
+		return nil, err
+	}
+	if err := d.fw.Flush(); err != nil {
+		return nil, err
+	}
+	out := d.out.Bytes()
+	if bytes.HasSuffix(out, syncFlushMarker) {
+		out = out[:len(out)-len(syncFlushMarker)]
+	}
+	return append([]byte(nil), out...), nil
+}
+
+// writeCompressedMessage writes a single permessage-deflate frame,
+// setting RSV1 per RFC 7692 section 6 so the peer's extension knows to
+// inflate the payload before treating it as op.
+func writeCompressedMessage(w io.Writer, op ws.OpCode, payload []byte) error {
+	frame := ws.NewFrame(op, true, payload)
+	frame.Header.Rsv = ws.Rsv(true, false, false)
+	return ws.WriteFrame(w, frame)
+}
+
+// deflateWindowSize is the maximum LZ77 window (RFC 7692's default
+// max_window_bits of 15), i.e. how much trailing decompressed output
+// deflateReader keeps around as a dictionary for the next message.
+const deflateWindowSize = 1 << 15
+
+// deflateReader inflates incoming permessage-deflate message payloads
+// with context-takeover. Each message is its own independent sync-flush
+// terminated deflate stream, so unlike deflateWriter's flate.Writer, a
+// single long-lived flate.Reader can't simply be fed across calls: once
+// it reaches the sync-flush's non-final block boundary, a reset reader
+// with no further bytes coming looks identical to a truncated stream,
+// and flate.Reader has no way to tell the difference. Instead, dict
+// carries the window forward by hand: decompress Resets the
+// flate.Reader onto each message with the previous message's trailing
+// output passed as the dictionary, mirroring context-takeover without
+// ever handing flate.Reader a stream it can't finish reading.
+type deflateReader struct {
+	fr   io.ReadCloser
+	dict []byte
+}
+
+func newDeflateReader() *deflateReader {
+	return &deflateReader{fr: flate.NewReader(bytes.NewReader(nil))}
+}
+
+// decompress re-appends the sync-flush marker the sender trimmed and
+// inflates p.
+func (d *deflateReader) decompress(p []byte) ([]byte, error) {
+	buf := make([]byte, 0, len(p)+len(syncFlushMarker))
+	buf = append(buf, p...)
+	buf = append(buf, syncFlushMarker...)
+	if err := d.fr.(flate.Resetter).Reset(bytes.NewReader(buf), d.dict); err != nil {
+		return nil, err
+	}
+	// buf is a non-final (BFINAL=0) sync-flush block, so flate.Reader
+	// hits the true end of it mid-stream and reports io.ErrUnexpectedEOF
+	// even though out already holds the complete decoded message.
+	out, err := io.ReadAll(d.fr)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	window := append(append([]byte(nil), d.dict...), out...)
+	if len(window) > deflateWindowSize {
+		window = window[len(window)-deflateWindowSize:]
+	}
+	d.dict = window
+	return out, nil
+}
+
+// readClientData is wsutil.ReadClientData's permessage-deflate-aware
+// sibling: it additionally reports whether the frame's RSV1 bit was set,
+// so the caller can run the payload through a deflateReader before using
+// it, the same way writeCompressedMessage sets RSV1 on the write side.
+func readClientData(rw io.ReadWriter) (payload []byte, op ws.OpCode, rsv1 bool, err error) {
+	controlHandler := wsutil.ControlFrameHandler(rw, ws.StateServerSide)
+	// StateExtended lets frames with RSV bits through the header check so
+	// RSV1 can be reported below instead of failing the read
+	rd := wsutil.Reader{
+		Source:         rw,
+		State:          ws.StateServerSide | ws.StateExtended,
+		OnIntermediate: controlHandler,
+	}
+	for {
+		hdr, herr := rd.NextFrame()
+		if herr != nil {
+			return nil, 0, false, herr
+		}
+		if hdr.OpCode.IsControl() {
+			if cerr := controlHandler(hdr, &rd); cerr != nil {
+				return nil, 0, false, cerr
+			}
+			continue
+		}
+		if hdr.OpCode != ws.OpText && hdr.OpCode != ws.OpBinary {
+			if derr := rd.Discard(); derr != nil {
+				return nil, 0, false, derr
+			}
+			continue
+		}
+		// a compressed text frame's wire bytes aren't valid UTF-8 on their
+		// own; only check once the caller has inflated it
+		rd.CheckUTF8 = hdr.OpCode == ws.OpText && !hdr.Rsv1()
+		payload, err = io.ReadAll(&rd)
+		return payload, hdr.OpCode, hdr.Rsv1(), err
+	}
+}
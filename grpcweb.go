@@ -0,0 +1,256 @@
+package rpc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/unistack-org/micro/v3/api"
+	"github.com/unistack-org/micro/v3/client"
+	"github.com/unistack-org/micro/v3/codec"
+	"github.com/unistack-org/micro/v3/errors"
+	"github.com/unistack-org/micro/v3/logger"
+	"github.com/unistack-org/micro/v3/util/router"
+)
+
+const (
+	grpcWebFlagData    byte = 0x00
+	grpcWebFlagTrailer byte = 0x80
+)
+
+// grpc-web codecs, framed the same way as grpc but usable from a browser
+// which can neither set the h2 :scheme pseudo-header nor read HTTP
+// trailers.
+var grpcWebCodecs = []string{
+	"application/grpc-web",
+	"application/grpc-web+proto",
+	"application/grpc-web-text",
+}
+
+func isGRPCWeb(ct string) bool {
+	return hasCodec(ct, grpcWebCodecs)
+}
+
+func grpcWebIsText(ct string) bool {
+	return strings.HasSuffix(ct, "-text")
+}
+
+// grpcWebFrame wraps payload in a single length-prefixed grpc-web frame:
+// a 1-byte flag, a 4-byte big-endian length, then the payload itself.
+func grpcWebFrame(flag byte, payload []byte) []byte {
+	buf := make([]byte, 5+len(payload))
+	buf[0] = flag
+	binary.BigEndian.PutUint32(buf[1:5], uint32(len(payload)))
+	copy(buf[5:], payload)
+	return buf
+}
+
+// grpcWebTrailerPayload renders the trailer frame body as the
+// "grpc-status"/"grpc-message" header lines a browser client expects in
+// place of real HTTP trailers.
+func grpcWebTrailerPayload(status int32, message string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "grpc-status: %d\r\n", status)
+	if message != "" {
+		fmt.Fprintf(&b, "grpc-message: %s\r\n", message)
+	}
+	return []byte(b.String())
+}
+
+// decodeGRPCWebBody base64-decodes a grpc-web-text body (if isText) and
+// strips the single length-prefixed frame down to its payload.
+func decodeGRPCWebBody(body []byte, isText bool) ([]byte, error) {
+	if isText {
+		dec := make([]byte, base64.StdEncoding.DecodedLen(len(body)))
+		n, err := base64.StdEncoding.Decode(dec, body)
+		if err != nil {
+			return nil, errors.BadRequest("go.micro.api", "invalid grpc-web-text body: %v", err)
+		}
+		body = dec[:n]
+	}
+	if len(body) < 5 {
+		return nil, errors.BadRequest("go.micro.api", "invalid grpc-web frame")
+	}
+	length := binary.BigEndian.Uint32(body[1:5])
+	if uint64(len(body)) < 5+uint64(length) {
+		return nil, errors.BadRequest("go.micro.api", "truncated grpc-web frame")
+	}
+	return body[5 : 5+length], nil
+}
+
+// grpcWebStreamWriter writes successive grpc-web frames to a streaming
+// response. grpc-web-text requires the whole response body to be one
+// continuous base64 stream rather than each frame encoded on its own
+// (which would insert spurious padding at frame boundaries), so for the
+// -text variant it wraps w in a single base64.Encoder for the life of
+// the stream instead of encoding frame-by-frame.
+type grpcWebStreamWriter struct {
+	w   io.Writer
+	b64 io.WriteCloser
+}
+
+func newGRPCWebStreamWriter(w http.ResponseWriter, ct string) *grpcWebStreamWriter {
+	if !grpcWebIsText(ct) {
+		return &grpcWebStreamWriter{w: w}
+	}
+	b64 := base64.NewEncoder(base64.StdEncoding, w)
+	return &grpcWebStreamWriter{w: b64, b64: b64}
+}
+
+// writeFrame writes a single grpc-web frame.
+func (g *grpcWebStreamWriter) writeFrame(flag byte, payload []byte) error {
+	_, err := g.w.Write(grpcWebFrame(flag, payload))
+	return err
+}
+
+// Close flushes any base64 bytes held back pending a full 3-byte group.
+// It is a no-op for the binary variant.
+func (g *grpcWebStreamWriter) Close() error {
+	if g.b64 == nil {
+		return nil
+	}
+	return g.b64.Close()
+}
+
+// httpStatusToGRPCCode maps an HTTP status, as carried on errors.Error.Code,
+// to the nearest real gRPC status code (0-16) so a grpc-web client sees a
+// value it can actually interpret, mirroring the mapping grpc-gateway uses
+// in the other direction.
+func httpStatusToGRPCCode(status int32) int32 {
+	switch status {
+	case http.StatusOK:
+		return 0 // OK
+	case http.StatusRequestTimeout:
+		return 4 // DEADLINE_EXCEEDED
+	case http.StatusBadRequest:
+		return 3 // INVALID_ARGUMENT
+	case http.StatusUnauthorized:
+		return 16 // UNAUTHENTICATED
+	case http.StatusForbidden:
+		return 7 // PERMISSION_DENIED
+	case http.StatusNotFound:
+		return 5 // NOT_FOUND
+	case http.StatusConflict:
+		return 10 // ABORTED
+	case http.StatusPreconditionFailed:
+		return 9 // FAILED_PRECONDITION
+	case http.StatusTooManyRequests:
+		return 8 // RESOURCE_EXHAUSTED
+	case 499: // Client Closed Request (nginx)
+		return 1 // CANCELLED
+	case http.StatusNotImplemented:
+		return 12 // UNIMPLEMENTED
+	case http.StatusServiceUnavailable:
+		return 14 // UNAVAILABLE
+	case http.StatusInternalServerError:
+		return 13 // INTERNAL
+	}
+	return 2 // UNKNOWN
+}
+
+// writeGRPCWebResponse re-frames a unary rsp as a DATA frame followed by
+// a TRAILERS frame carrying the grpc-status/grpc-message, since browsers
+// reading grpc-web responses cannot see real HTTP trailers.
+func writeGRPCWebResponse(w http.ResponseWriter, ct string, data []byte, status int32, message string) {
+	out := append(grpcWebFrame(grpcWebFlagData, data), grpcWebFrame(grpcWebFlagTrailer, grpcWebTrailerPayload(status, message))...)
+	if grpcWebIsText(ct) {
+		out = []byte(base64.StdEncoding.EncodeToString(out))
+	}
+	w.Header().Set("Content-Type", ct)
+	w.WriteHeader(http.StatusOK)
+	w.Write(out)
+}
+
+// serveGRPCWebStream is the grpc-web sibling of serveWebsocket: it keeps
+// the HTTP response open and writes successive DATA frames as the
+// backend stream produces them, finishing with a TRAILERS frame.
+func serveGRPCWebStream(ctx context.Context, w http.ResponseWriter, r *http.Request, service *api.Service, c client.Client, ct string, opts Options) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, r, errors.InternalServerError("go.micro.api", "streaming not supported"))
+		return
+	}
+
+	payload, err := requestPayload(r, opts)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	frame, err := decodeGRPCWebBody(payload, grpcWebIsText(ct))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	callOpts := []client.CallOption{client.WithRouter(router.New(service.Services))}
+	request := &codec.Frame{Data: frame}
+
+	req := c.NewRequest(
+		service.Name,
+		service.Endpoint.Name,
+		request,
+		client.WithContentType("application/grpc"),
+		client.StreamingRequest(),
+	)
+
+	stream, err := c.Stream(ctx, req, callOpts...)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	defer stream.Close()
+
+	if err = stream.Send(request); err != nil {
+		if logger.V(logger.ErrorLevel) {
+			logger.Error(ctx, err.Error())
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", ct)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	sw := newGRPCWebStreamWriter(w, ct)
+	defer sw.Close()
+
+	rsp := stream.Response()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-stream.Context().Done():
+			return
+		default:
+			buf, rerr := rsp.Read()
+			if rerr != nil {
+				var status int32
+				var message string
+				if !strings.Contains(rerr.Error(), "context canceled") {
+					status, message = 13, rerr.Error()
+				}
+				if werr := sw.writeFrame(grpcWebFlagTrailer, grpcWebTrailerPayload(status, message)); werr != nil {
+					if logger.V(logger.ErrorLevel) {
+						logger.Error(ctx, werr.Error())
+					}
+				}
+				flusher.Flush()
+				return
+			}
+
+			if err := sw.writeFrame(grpcWebFlagData, buf); err != nil {
+				if logger.V(logger.ErrorLevel) {
+					logger.Error(ctx, err.Error())
+				}
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package rpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// multipartFile describes a single uploaded file part once it has been
+// pulled out of the multipart form and turned into JSON.
+type multipartFile struct {
+	Name          string `json:"name"`
+	Filename      string `json:"filename"`
+	ContentType   string `json:"content_type"`
+	Size          int64  `json:"size"`
+	ContentBase64 string `json:"content_base64,omitempty"`
+	Ref           string `json:"ref,omitempty"`
+}
+
+// decodeMultipartForm turns a multipart/form-data request into a JSON
+// document: scalar fields become top level string values, and uploaded
+// files become a "files" array of multipartFile entries.
+func decodeMultipartForm(r *http.Request, opts Options) ([]byte, error) {
+	if err := r.ParseMultipartForm(opts.MaxRecvSize); err != nil {
+		return nil, err
+	}
+
+	doc := make(map[string]interface{}, len(r.MultipartForm.Value)+1)
+	for k, v := range r.MultipartForm.Value {
+		doc[k] = strings.Join(v, ",")
+	}
+
+	var files []multipartFile
+	for name, headers := range r.MultipartForm.File {
+		for _, fh := range headers {
+			mf, err := readMultipartFile(r.Context(), name, fh, opts)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, mf)
+		}
+	}
+	if len(files) > 0 {
+		doc["files"] = files
+	}
+
+	return json.Marshal(doc)
+}
+
+// readMultipartFile copies a single file part into a pooled buffer and,
+// depending on opts.MultipartMode, either inlines it as base64 or writes
+// it to opts.Store and leaves a reference token in its place. The whole
+// part is held in memory while this happens; only the buffer itself is
+// reused across calls.
+func readMultipartFile(ctx context.Context, name string, fh *multipart.FileHeader, opts Options) (multipartFile, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return multipartFile{}, err
+	}
+	defer f.Close()
+
+	buf := opts.pool.Get()
+	defer opts.pool.Put(buf)
+
+	if _, err := io.Copy(buf, f); err != nil {
+		return multipartFile{}, err
+	}
+
+	mf := multipartFile{
+		Name:        name,
+		Filename:    fh.Filename,
+		ContentType: fh.Header.Get("Content-Type"),
+		Size:        fh.Size,
+	}
+
+	switch opts.MultipartMode {
+	case MultipartReference:
+		ref := newMultipartRef()
+		if err := opts.Store.Write(ctx, ref, append([]byte(nil), buf.Bytes()...)); err != nil {
+			return multipartFile{}, err
+		}
+		mf.Ref = ref
+	default:
+		mf.ContentBase64 = base64.StdEncoding.EncodeToString(buf.Bytes())
+	}
+
+	return mf, nil
+}
+
+// newMultipartRef generates an opaque reference token for a file stored
+// via MultipartReference mode.
+func newMultipartRef() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("upload-%x", b)
+}
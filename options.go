@@ -0,0 +1,146 @@
+package rpc
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/oxtoacart/bpool"
+	"github.com/unistack-org/micro/v3/api/handler"
+	"github.com/unistack-org/micro/v3/store"
+)
+
+// MultipartMode controls how multipart/form-data file parts are turned
+// into the JSON document forwarded to the backend.
+type MultipartMode int
+
+const (
+	// MultipartInline embeds each file as base64 content in the JSON
+	// document. This is the default.
+	MultipartInline MultipartMode = iota
+	// MultipartReference writes each file to the configured store.Store
+	// and embeds a reference token in its place, keeping large uploads
+	// out of the RPC payload.
+	MultipartReference
+)
+
+// Options extends the handler.Options shared by all unistack-org/micro api
+// handlers with settings specific to this rpc handler implementation.
+type Options struct {
+	handler.Options
+	// MultipartMode selects how multipart/form-data file parts are
+	// represented in the forwarded JSON document.
+	MultipartMode MultipartMode
+	// Store backs MultipartReference mode.
+	Store store.Store
+	// SubprotocolCodecs maps a negotiated Sec-WebSocket-Protocol value to
+	// the codec used to translate its framing to/from the backend stream.
+	SubprotocolCodecs map[string]SubprotocolCodec
+	// ReauthInterval, if non-zero, re-runs authorization for long-lived
+	// websocket connections on this interval.
+	ReauthInterval time.Duration
+	// ReauthFunc overrides how reauthorization is performed; if nil,
+	// Router.Route is re-run and the resulting endpoint compared.
+	ReauthFunc func(*http.Request) error
+	// pool buffers POST/PATCH body reads and multipart file parts; see
+	// WithBufferPool.
+	pool *bpool.SizedBufferPool
+	// CompressionLevel is the flate level used to compress outgoing
+	// websocket messages once permessage-deflate is negotiated; zero (the
+	// default) keeps the extension disabled. See WithWebSocketCompression.
+	CompressionLevel int
+	// CompressionThreshold is the payload size, in bytes, a message must
+	// exceed before it is compressed.
+	CompressionThreshold int
+}
+
+// Option configures an rpcHandler.
+type Option func(*Options)
+
+func newOptions(opts ...Option) Options {
+	options := Options{
+		Options: handler.NewOptions(),
+		Store:   store.DefaultStore,
+		pool:    bpool.NewSizedBufferPool(1024, 8),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	return options
+}
+
+// WithHandlerOption adapts a handler.Option (WithRouter, WithNamespace,
+// WithClient, WithMaxRecvSize, ...) for use with NewHandler/WithService.
+func WithHandlerOption(o handler.Option) Option {
+	return func(opts *Options) {
+		o(&opts.Options)
+	}
+}
+
+// WithMultipartMode selects how multipart/form-data file parts are
+// represented in the JSON document forwarded to the backend.
+func WithMultipartMode(mode MultipartMode) Option {
+	return func(opts *Options) {
+		opts.MultipartMode = mode
+	}
+}
+
+// WithStore sets the store.Store used by MultipartReference mode.
+func WithStore(s store.Store) Option {
+	return func(opts *Options) {
+		opts.Store = s
+	}
+}
+
+// WithSubprotocolCodec registers the codec used to translate a
+// negotiated Sec-WebSocket-Protocol, e.g. "channel.k8s.io" or
+// "v4.channel.k8s.io", to and from the backend stream's framing.
+func WithSubprotocolCodec(protocol string, codec SubprotocolCodec) Option {
+	return func(opts *Options) {
+		if opts.SubprotocolCodecs == nil {
+			opts.SubprotocolCodecs = make(map[string]SubprotocolCodec)
+		}
+		opts.SubprotocolCodecs[protocol] = codec
+	}
+}
+
+// WithReauthInterval enables periodic reauthorization of long-lived
+// websocket connections on the given interval.
+func WithReauthInterval(interval time.Duration) Option {
+	return func(opts *Options) {
+		opts.ReauthInterval = interval
+	}
+}
+
+// WithReauthFunc overrides how a websocket connection is reauthorized;
+// without it, Router.Route is re-run and the resulting endpoint compared
+// against the one the connection was opened for.
+func WithReauthFunc(fn func(*http.Request) error) Option {
+	return func(opts *Options) {
+		opts.ReauthFunc = fn
+	}
+}
+
+// WithBufferPool replaces the default sized buffer pool (1024 buffers,
+// 8 bytes initial allocation each) used to read POST/PATCH bodies and
+// multipart file parts.
+func WithBufferPool(size, allocSize int) Option {
+	return func(opts *Options) {
+		opts.pool = bpool.NewSizedBufferPool(size, allocSize)
+	}
+}
+
+// WithWebSocketCompression enables the permessage-deflate extension
+// (RFC 7692) for websocket streams, negotiating it when the client
+// offers it and compressing outgoing messages larger than threshold
+// bytes at the given flate level. It is disabled by default (level 0).
+//
+// Compression is orthogonal to subprotocol negotiation: a connection
+// that negotiates "Sec-WebSocket-Protocol: binary" still forces
+// ws.OpBinary framing, but its payloads are deflated the same as any
+// other stream once permessage-deflate is negotiated.
+func WithWebSocketCompression(level, threshold int) Option {
+	return func(opts *Options) {
+		opts.CompressionLevel = level
+		opts.CompressionThreshold = threshold
+	}
+}
@@ -0,0 +1,105 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/unistack-org/micro/v3/api"
+	"github.com/unistack-org/micro/v3/client"
+	"github.com/unistack-org/micro/v3/errors"
+	"github.com/unistack-org/micro/v3/util/qson"
+	"github.com/unistack-org/micro/v3/util/router"
+)
+
+const (
+	contentTypeJSONPatch  = "application/json-patch+json"
+	contentTypeMergePatch = "application/merge-patch+json"
+)
+
+// isPatchContentType reports whether ct is a JSON Patch (RFC 6902) or
+// JSON Merge Patch (RFC 7396) media type.
+func isPatchContentType(ct string) bool {
+	switch ct {
+	case contentTypeJSONPatch, contentTypeMergePatch:
+		return true
+	}
+	return false
+}
+
+// patchGetEndpoint returns the sibling endpoint declared to fetch the
+// current resource for the endpoint being called, e.g. a `patch_get`
+// metadata value of "Service.Get" on the matched registry endpoint.
+func patchGetEndpoint(service *api.Service) string {
+	for _, svc := range service.Services {
+		for _, ep := range svc.Endpoints {
+			if ep.Name != service.Endpoint.Name {
+				continue
+			}
+			if get := ep.Metadata["patch_get"]; get != "" {
+				return get
+			}
+		}
+	}
+	return ""
+}
+
+// applyPatch fetches the current resource via the endpoint's configured
+// patch_get sibling, applies the JSON Patch or JSON Merge Patch document
+// in patchBody to it, and returns the resulting merged document so it
+// can be forwarded to the target endpoint as a regular request body.
+func applyPatch(cx context.Context, r *http.Request, service *api.Service, c client.Client, ct string, patchBody []byte) ([]byte, error) {
+	get := patchGetEndpoint(service)
+	if get == "" {
+		return nil, errors.BadRequest("go.micro.api", "no patch_get endpoint configured for %s", service.Endpoint.Name)
+	}
+
+	callOpts := []client.CallOption{client.WithRouter(router.New(service.Services))}
+
+	// identify the resource to fetch the same way the plain GET path
+	// does: the URL query (and any path params the router folds into it)
+	// marshaled to JSON, since PATCH carries the patch document, not the
+	// resource identity, in its body
+	getBody := []byte("{}")
+	if len(r.URL.RawQuery) > 0 {
+		b, err := qson.ToJSON(r.URL.RawQuery)
+		if err != nil {
+			return nil, errors.BadRequest("go.micro.api", "invalid query: %v", err)
+		}
+		getBody = b
+	}
+	request := json.RawMessage(getBody)
+	var current json.RawMessage
+
+	req := c.NewRequest(
+		service.Name,
+		get,
+		&request,
+		client.WithContentType("application/json"),
+	)
+
+	if err := c.Call(cx, req, &current, callOpts...); err != nil {
+		return nil, err
+	}
+
+	var merged []byte
+	var err error
+
+	switch ct {
+	case contentTypeJSONPatch:
+		var patch jsonpatch.Patch
+		if patch, err = jsonpatch.DecodePatch(patchBody); err != nil {
+			return nil, errors.BadRequest("go.micro.api", "invalid json patch: %v", err)
+		}
+		merged, err = patch.Apply(current)
+	case contentTypeMergePatch:
+		merged, err = jsonpatch.MergePatch(current, patchBody)
+	}
+
+	if err != nil {
+		return nil, errors.BadRequest("go.micro.api", "failed to apply patch: %v", err)
+	}
+
+	return merged, nil
+}
@@ -2,26 +2,22 @@
 package rpc
 
 import (
+	"bytes"
 	"encoding/json"
 	"io"
 	"net/http"
 	"strconv"
 	"strings"
 
-	"github.com/joncalhoun/qson"
-	"github.com/micro/go-micro/v2/api"
-	"github.com/micro/go-micro/v2/api/handler"
-	proto "github.com/micro/go-micro/v2/api/internal/proto"
-	"github.com/micro/go-micro/v2/client"
-	"github.com/micro/go-micro/v2/client/selector"
-	"github.com/micro/go-micro/v2/codec"
-	"github.com/micro/go-micro/v2/codec/jsonrpc"
-	"github.com/micro/go-micro/v2/codec/protorpc"
-	"github.com/micro/go-micro/v2/errors"
-	"github.com/micro/go-micro/v2/logger"
-	"github.com/micro/go-micro/v2/registry"
-	"github.com/micro/go-micro/v2/util/ctx"
-	"github.com/oxtoacart/bpool"
+	"github.com/unistack-org/micro/v3/api"
+	"github.com/unistack-org/micro/v3/api/handler"
+	"github.com/unistack-org/micro/v3/client"
+	"github.com/unistack-org/micro/v3/codec"
+	"github.com/unistack-org/micro/v3/errors"
+	"github.com/unistack-org/micro/v3/logger"
+	"github.com/unistack-org/micro/v3/util/ctx"
+	"github.com/unistack-org/micro/v3/util/qson"
+	"github.com/unistack-org/micro/v3/util/router"
 )
 
 const (
@@ -45,31 +41,13 @@ var (
 		"application/proto-rpc",
 		"application/octet-stream",
 	}
-
-	bufferPool = bpool.NewSizedBufferPool(1024, 8)
 )
 
 type rpcHandler struct {
-	opts handler.Options
+	opts Options
 	s    *api.Service
 }
 
-type buffer struct {
-	io.ReadCloser
-}
-
-func (b *buffer) Write(_ []byte) (int, error) {
-	return 0, nil
-}
-
-// strategy is a hack for selection
-func strategy(services []*registry.Service) selector.Strategy {
-	return func(_ []*registry.Service) selector.Next {
-		// ignore input to this function, use services above
-		return selector.Random(services)
-	}
-}
-
 func (h *rpcHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	bsize := handler.DefaultMaxRecvSize
 	if h.opts.MaxRecvSize > 0 {
@@ -98,8 +76,8 @@ func (h *rpcHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// only allow post when we have the router
-	if r.Method != "GET" && (h.opts.Router != nil && r.Method != "POST") {
+	// only allow post and patch when we have the router
+	if r.Method != "GET" && (h.opts.Router != nil && r.Method != "POST" && r.Method != "PATCH") {
 		writeError(w, r, errors.MethodNotAllowed("go.micro.api", "method not allowed"))
 		return
 	}
@@ -112,42 +90,78 @@ func (h *rpcHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// micro client
-	c := h.opts.Service.Client()
+	c := h.opts.Client
 
 	// create context
 	cx := ctx.FromRequest(r)
 
+	grpcWeb := isGRPCWeb(ct)
+	grpcWebCT := ct
+
 	// if stream we currently only support json
-	if isStream(r, service) {
-		serveWebsocket(cx, w, r, service, c)
+	switch {
+	case grpcWeb && isEndpointStream(service):
+		serveGRPCWebStream(cx, w, r, service, c, ct, h.opts)
 		return
+	case isEventStream(r, service):
+		serveEventStream(cx, w, r, service, c, h.opts)
+		return
+	case isStream(r, service):
+		serveWebsocket(cx, w, r, service, c, h.opts)
+		return
+	}
+
+	// grpc-web frames the proto message with a 1-byte flag + 4-byte
+	// length prefix (and base64-encodes the whole thing for -text); peel
+	// that off and run the rest of the call path as plain application/grpc
+	if grpcWeb {
+		body, berr := io.ReadAll(r.Body)
+		if berr != nil {
+			writeError(w, r, berr)
+			return
+		}
+		frame, ferr := decodeGRPCWebBody(body, grpcWebIsText(ct))
+		if ferr != nil {
+			writeError(w, r, ferr)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(frame))
+		ct = "application/grpc"
 	}
 
-	// create strategy
-	so := selector.WithStrategy(strategy(service.Services))
+	// route this call the same way the streaming paths do: the service
+	// was already resolved above, so there's no registry to select from
+	callOpts := []client.CallOption{client.WithRouter(router.New(service.Services))}
 
 	// walk the standard call path
 
 	// get payload
-	br, err := requestPayload(r)
+	br, err := requestPayload(r, h.opts)
 	if err != nil {
 		writeError(w, r, err)
 		return
 	}
 
+	// a JSON Patch / JSON Merge Patch body isn't valid on its own - fetch
+	// the current resource, apply the patch and forward the merged
+	// document to the target endpoint as if it were a normal request
+	if r.Method == "PATCH" && isPatchContentType(ct) {
+		merged, err := applyPatch(cx, r, service, c, ct, br)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		br = merged
+		ct = "application/json"
+	}
+
 	var rsp []byte
 
 	switch {
 	// proto codecs
 	case hasCodec(ct, protoCodecs):
-		request := &proto.Message{}
-		// if the extracted payload isn't empty lets use it
-		if len(br) > 0 {
-			request = proto.NewMessage(br)
-		}
-
-		// create request/response
-		response := &proto.Message{}
+		request := &codec.Frame{Data: br}
+		response := &codec.Frame{}
 
 		req := c.NewRequest(
 			service.Name,
@@ -157,13 +171,13 @@ func (h *rpcHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		)
 
 		// make the call
-		if err := c.Call(cx, req, response, client.WithSelectOption(so)); err != nil {
+		if err := c.Call(cx, req, response, callOpts...); err != nil {
 			writeError(w, r, err)
 			return
 		}
 
 		// marshall response
-		rsp, _ = response.Marshal()
+		rsp = response.Data
 	default:
 		// if json codec is not present set to json
 		if !hasCodec(ct, jsonCodecs) {
@@ -188,7 +202,7 @@ func (h *rpcHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		)
 
 		// make the call
-		if err := c.Call(cx, req, &response, client.WithSelectOption(so)); err != nil {
+		if err := c.Call(cx, req, &response, callOpts...); err != nil {
 			writeError(w, r, err)
 			return
 		}
@@ -197,6 +211,11 @@ func (h *rpcHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		rsp, _ = response.MarshalJSON()
 	}
 
+	if grpcWeb {
+		writeGRPCWebResponse(w, grpcWebCT, rsp, 0, "")
+		return
+	}
+
 	// write the response
 	writeResponse(w, r, rsp)
 }
@@ -217,40 +236,11 @@ func hasCodec(ct string, codecs []string) bool {
 // requestPayload takes a *http.Request.
 // If the request is a GET the query string parameters are extracted and marshaled to JSON and the raw bytes are returned.
 // If the request method is a POST the request body is read and returned
-func requestPayload(r *http.Request) ([]byte, error) {
-	// we have to decode json-rpc and proto-rpc because we suck
-	// well actually because there's no proxy codec right now
+func requestPayload(r *http.Request, opts Options) ([]byte, error) {
 	ct := r.Header.Get("Content-Type")
 	switch {
-	case strings.Contains(ct, "application/json-rpc"):
-		msg := codec.Message{
-			Type:   codec.Request,
-			Header: make(map[string]string),
-		}
-		c := jsonrpc.NewCodec(&buffer{r.Body})
-		if err := c.ReadHeader(&msg, codec.Request); err != nil {
-			return nil, err
-		}
-		var raw json.RawMessage
-		if err := c.ReadBody(&raw); err != nil {
-			return nil, err
-		}
-		return ([]byte)(raw), nil
-	case strings.Contains(ct, "application/proto-rpc"), strings.Contains(ct, "application/octet-stream"):
-		msg := codec.Message{
-			Type:   codec.Request,
-			Header: make(map[string]string),
-		}
-		c := protorpc.NewCodec(&buffer{r.Body})
-		if err := c.ReadHeader(&msg, codec.Request); err != nil {
-			return nil, err
-		}
-		var raw proto.Message
-		if err := c.ReadBody(&raw); err != nil {
-			return nil, err
-		}
-		b, err := raw.Marshal()
-		return b, err
+	case strings.Contains(ct, "multipart/form-data"):
+		return decodeMultipartForm(r, opts)
 	case strings.Contains(ct, "application/www-x-form-urlencoded"):
 		r.ParseForm()
 
@@ -274,8 +264,11 @@ func requestPayload(r *http.Request) ([]byte, error) {
 			return qson.ToJSON(r.URL.RawQuery)
 		}
 	case "PATCH", "POST":
-		buf := bufferPool.Get()
-		defer bufferPool.Put(buf)
+		// json-patch+json and merge-patch+json bodies are plain JSON
+		// documents too; rpcHandler.ServeHTTP merges them with the
+		// current resource before the call is made
+		buf := opts.pool.Get()
+		defer opts.pool.Put(buf)
 		if _, err := buf.ReadFrom(r.Body); err != nil {
 			return nil, err
 		}
@@ -288,23 +281,33 @@ func requestPayload(r *http.Request) ([]byte, error) {
 func writeError(w http.ResponseWriter, r *http.Request, err error) {
 	ce := errors.Parse(err.Error())
 
-	switch ce.Code {
-	case 0:
+	if ce.Code == 0 {
 		// assuming it's totally screwed
 		ce.Code = 500
 		ce.Id = "go.micro.api"
 		ce.Status = http.StatusText(500)
 		ce.Detail = "error during request: " + ce.Detail
-		w.WriteHeader(500)
-	default:
-		w.WriteHeader(int(ce.Code))
 	}
 
+	reqCT := r.Header.Get("Content-Type")
+	if idx := strings.IndexRune(reqCT, ';'); idx >= 0 {
+		reqCT = reqCT[:idx]
+	}
+
+	// grpc-web can't read HTTP trailers in the browser, so the
+	// grpc-status/grpc-message pair goes in a TRAILERS frame instead
+	if isGRPCWeb(reqCT) {
+		writeGRPCWebResponse(w, reqCT, nil, httpStatusToGRPCCode(ce.Code), ce.Detail)
+		return
+	}
+
+	w.WriteHeader(int(ce.Code))
+
 	// response content type
 	w.Header().Set("Content-Type", "application/json")
 
 	// Set trailers
-	if strings.Contains(r.Header.Get("Content-Type"), "application/grpc") {
+	if strings.Contains(reqCT, "application/grpc") {
 		w.Header().Set("Trailer", "grpc-status")
 		w.Header().Set("Trailer", "grpc-message")
 		w.Header().Set("grpc-status", "13")
@@ -312,9 +315,9 @@ func writeError(w http.ResponseWriter, r *http.Request, err error) {
 	}
 
 	_, werr := w.Write([]byte(ce.Error()))
-	if err != nil {
-		if logger.V(logger.ErrorLevel, logger.DefaultLogger) {
-			logger.Error(werr)
+	if werr != nil {
+		if logger.V(logger.ErrorLevel) {
+			logger.Error(r.Context(), werr.Error())
 		}
 	}
 }
@@ -334,22 +337,22 @@ func writeResponse(w http.ResponseWriter, r *http.Request, rsp []byte) {
 	// write response
 	_, err := w.Write(rsp)
 	if err != nil {
-		if logger.V(logger.ErrorLevel, logger.DefaultLogger) {
-			logger.Error(err)
+		if logger.V(logger.ErrorLevel) {
+			logger.Error(r.Context(), err.Error())
 		}
 	}
 
 }
 
-func NewHandler(opts ...handler.Option) handler.Handler {
-	options := handler.NewOptions(opts...)
+func NewHandler(opts ...Option) handler.Handler {
+	options := newOptions(opts...)
 	return &rpcHandler{
 		opts: options,
 	}
 }
 
-func WithService(s *api.Service, opts ...handler.Option) handler.Handler {
-	options := handler.NewOptions(opts...)
+func WithService(s *api.Service, opts ...Option) handler.Handler {
+	options := newOptions(opts...)
 	return &rpcHandler{
 		opts: options,
 		s:    s,
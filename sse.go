@@ -0,0 +1,202 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/unistack-org/micro/v3/api"
+	"github.com/unistack-org/micro/v3/client"
+	"github.com/unistack-org/micro/v3/codec"
+	"github.com/unistack-org/micro/v3/errors"
+	"github.com/unistack-org/micro/v3/logger"
+	"github.com/unistack-org/micro/v3/metadata"
+	"github.com/unistack-org/micro/v3/util/router"
+)
+
+// DefaultSSEHeartbeat is the interval at which a ": keepalive" comment is
+// sent on an otherwise idle event stream so intermediate proxies don't
+// time out the connection.
+var DefaultSSEHeartbeat = 15 * time.Second
+
+type sseFrame struct {
+	buf []byte
+	err error
+}
+
+// serveEventStream streams rpc responses back to the client as
+// Server-Sent Events rather than upgrading to a websocket.
+func serveEventStream(ctx context.Context, w http.ResponseWriter, r *http.Request, service *api.Service, c client.Client, opts Options) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, r, errors.InternalServerError("go.micro.api", "streaming not supported"))
+		return
+	}
+
+	ct := r.Header.Get("Content-Type")
+	// Strip charset from Content-Type (like `application/json; charset=UTF-8`)
+	if idx := strings.IndexRune(ct, ';'); idx >= 0 {
+		ct = ct[:idx]
+	}
+	if ct == "" {
+		ct = "application/json"
+	}
+
+	// create custom router
+	callOpts := []client.CallOption{client.WithRouter(router.New(service.Services))}
+
+	if t := r.Header.Get("Timeout"); t != "" {
+		// assume timeout integer seconds
+		if td, err := time.ParseDuration(t + "s"); err == nil {
+			callOpts = append(callOpts, client.WithRequestTimeout(td))
+		}
+	}
+
+	payload, err := requestPayload(r, opts)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var request interface{}
+	switch ct {
+	case "application/json":
+		m := json.RawMessage(payload)
+		request = &m
+	default:
+		request = &codec.Frame{Data: payload}
+	}
+
+	req := c.NewRequest(
+		service.Name,
+		service.Endpoint.Name,
+		request,
+		client.WithContentType(ct),
+		client.StreamingRequest(),
+	)
+
+	// a resuming EventSource sends back the last id it saw; forward it in
+	// the outgoing metadata so the handler can rewind its stream to it
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		ctx = metadata.AppendOutgoingContext(ctx, "Last-Event-ID", lastEventID)
+	}
+
+	// create a new stream
+	stream, err := c.Stream(ctx, req, callOpts...)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	defer stream.Close()
+
+	if request != nil {
+		if err = stream.Send(request); err != nil {
+			if logger.V(logger.ErrorLevel) {
+				logger.Error(ctx, err.Error())
+			}
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := DefaultSSEHeartbeat
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	rsp := stream.Response()
+	frames := make(chan sseFrame)
+
+	// done tells the reader goroutine to stop offering frames once this
+	// function returns; without it, a goroutine blocked on rsp.Read() past
+	// that point would eventually unblock and then block forever sending
+	// to frames, since nothing would be left to receive it.
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for {
+			buf, rerr := rsp.Read()
+			select {
+			case frames <- sseFrame{buf: buf, err: rerr}:
+			case <-done:
+				return
+			}
+			if rerr != nil {
+				return
+			}
+		}
+	}()
+
+	var id int
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-stream.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case f := <-frames:
+			if f.err != nil {
+				// wants to avoid import grpc/status.Status
+				if strings.Contains(f.err.Error(), "context canceled") {
+					return
+				}
+				if logger.V(logger.ErrorLevel) {
+					logger.Error(ctx, f.err.Error())
+				}
+				return
+			}
+
+			id++
+			if _, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", id, f.buf); err != nil {
+				return
+			}
+			flusher.Flush()
+			ticker.Reset(heartbeat)
+		}
+	}
+}
+
+// isEventStream reports whether the request should be served as an
+// EventSource/SSE stream rather than a websocket: the matched endpoint
+// must support streaming (the same isEndpointStream guard the other
+// transport branches use), and either the client asks for it via
+// Accept, or the endpoint declares sse=true.
+func isEventStream(r *http.Request, srv *api.Service) bool {
+	if !isEndpointStream(srv) {
+		return false
+	}
+
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if strings.TrimSpace(accept) == "text/event-stream" {
+			return true
+		}
+	}
+
+	for _, service := range srv.Services {
+		for _, ep := range service.Endpoints {
+			if ep.Name != srv.Endpoint.Name {
+				continue
+			}
+			if v := ep.Metadata["sse"]; v == "true" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
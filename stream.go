@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gobwas/httphead"
@@ -19,7 +20,7 @@ import (
 )
 
 // serveWebsocket will stream rpc back over websockets assuming json
-func serveWebsocket(ctx context.Context, w http.ResponseWriter, r *http.Request, service *api.Service, c client.Client) {
+func serveWebsocket(ctx context.Context, w http.ResponseWriter, r *http.Request, service *api.Service, c client.Client, opts Options) {
 	var op ws.OpCode
 
 	ct := r.Header.Get("Content-Type")
@@ -46,9 +47,20 @@ func serveWebsocket(ctx context.Context, w http.ResponseWriter, r *http.Request,
 		op = ws.OpBinary
 	}
 
+	var subCodec SubprotocolCodec
+	var pmdNegotiated bool
+
+	wantSubprotocol := endpointSubprotocol(service)
+
 	hdr := make(http.Header)
-	if proto, ok := r.Header["Sec-WebSocket-Protocol"]; ok {
-		for _, p := range proto {
+	for _, line := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, p := range strings.Split(line, ",") {
+			p = strings.TrimSpace(p)
+			if sc, ok := opts.SubprotocolCodecs[p]; ok && p == wantSubprotocol {
+				hdr["Sec-WebSocket-Protocol"] = []string{p}
+				subCodec = sc
+				continue
+			}
 			switch p {
 			case "binary":
 				hdr["Sec-WebSocket-Protocol"] = []string{"binary"}
@@ -58,7 +70,7 @@ func serveWebsocket(ctx context.Context, w http.ResponseWriter, r *http.Request,
 			}
 		}
 	}
-	payload, err := requestPayload(r)
+	payload, err := requestPayload(r, opts)
 	if err != nil {
 		if logger.V(logger.ErrorLevel) {
 			logger.Error(ctx, err.Error())
@@ -74,8 +86,20 @@ func serveWebsocket(ctx context.Context, w http.ResponseWriter, r *http.Request,
 			// fallback to support all protocols now
 			return true
 		},
-		Extension: func(httphead.Option) bool {
-			// disable extensions for compatibility
+		Extension: func(opt httphead.Option) bool {
+			// permessage-deflate (RFC 7692) is the only extension we
+			// know about, and only if WithWebSocketCompression enabled
+			// it; everything else is rejected for compatibility.
+			// ws.HTTPUpgrader echoes opt back to the client unchanged
+			// when this returns true, and we only implement the
+			// no-parameter default (context-takeover kept in both
+			// directions), so negotiatePermessageDeflate refuses any
+			// offer that carries parameters rather than silently
+			// agreeing to ones we don't honor.
+			if negotiatePermessageDeflate(opts, opt) {
+				pmdNegotiated = true
+				return true
+			}
 			return false
 		},
 		Header: hdr,
@@ -98,6 +122,13 @@ func serveWebsocket(ctx context.Context, w http.ResponseWriter, r *http.Request,
 		}
 	}()
 
+	var dw *deflateWriter
+	var dr *deflateReader
+	if pmdNegotiated {
+		dw = newDeflateWriter(opts.CompressionLevel)
+		dr = newDeflateReader()
+	}
+
 	var request interface{}
 
 	switch ct {
@@ -117,8 +148,8 @@ func serveWebsocket(ctx context.Context, w http.ResponseWriter, r *http.Request,
 		service.Name,
 		service.Endpoint.Name,
 		request,
-		client.RequestContentType(ct),
-		client.StreamingRequest(true),
+		client.WithContentType(ct),
+		client.StreamingRequest(),
 	)
 
 	// create a new stream
@@ -139,7 +170,17 @@ func serveWebsocket(ctx context.Context, w http.ResponseWriter, r *http.Request,
 		}
 	}
 
-	go writeLoop(rw, stream)
+	// guards writes to rw: the main loop below and reauthLoop (on
+	// reauthorization failure) can both write frames to the connection
+	// concurrently and must not interleave them
+	var wmu sync.Mutex
+
+	stop := make(chan struct{})
+	if opts.ReauthInterval > 0 {
+		go reauthLoop(ctx, rw, &wmu, r, service, opts, stop)
+	}
+
+	go writeLoop(rw, stream, subCodec, dr)
 
 	rsp := stream.Response()
 
@@ -150,6 +191,8 @@ func serveWebsocket(ctx context.Context, w http.ResponseWriter, r *http.Request,
 			return
 		case <-stream.Context().Done():
 			return
+		case <-stop:
+			return
 		default:
 			// read backend response body
 			buf, err := rsp.Read()
@@ -164,14 +207,39 @@ func serveWebsocket(ctx context.Context, w http.ResponseWriter, r *http.Request,
 				return
 			}
 
-			// write the response
-			if err = wsutil.WriteServerMessage(rw, op, buf); err != nil {
-				if logger.V(logger.ErrorLevel) {
-					logger.Error(ctx, err.Error())
+			frameOp := op
+			if subCodec != nil {
+				var encErr error
+				buf, frameOp, encErr = subCodec.Encode(op, buf)
+				if encErr != nil {
+					if logger.V(logger.ErrorLevel) {
+						logger.Error(ctx, encErr.Error())
+					}
+					return
 				}
-				return
 			}
-			if err = rw.Flush(); err != nil {
+
+			// write the response, compressing it first if
+			// permessage-deflate was negotiated and it's worth it
+			wmu.Lock()
+			if pmdNegotiated && len(buf) > opts.CompressionThreshold {
+				cbuf, cerr := dw.compress(buf)
+				if cerr != nil {
+					wmu.Unlock()
+					if logger.V(logger.ErrorLevel) {
+						logger.Error(ctx, cerr.Error())
+					}
+					return
+				}
+				err = writeCompressedMessage(rw, frameOp, cbuf)
+			} else {
+				err = wsutil.WriteServerMessage(rw, frameOp, buf)
+			}
+			if err == nil {
+				err = rw.Flush()
+			}
+			wmu.Unlock()
+			if err != nil {
 				if logger.V(logger.ErrorLevel) {
 					logger.Error(ctx, err.Error())
 				}
@@ -181,8 +249,10 @@ func serveWebsocket(ctx context.Context, w http.ResponseWriter, r *http.Request,
 	}
 }
 
-// writeLoop
-func writeLoop(rw io.ReadWriter, stream client.Stream) {
+// writeLoop reads client frames off rw and forwards them to stream. dr is
+// non-nil when permessage-deflate was negotiated, and inflates any frame
+// whose RSV1 bit marks it as compressed before the payload is used.
+func writeLoop(rw io.ReadWriter, stream client.Stream, subCodec SubprotocolCodec, dr *deflateReader) {
 	// close stream when done
 	defer stream.Close()
 
@@ -191,7 +261,7 @@ func writeLoop(rw io.ReadWriter, stream client.Stream) {
 		case <-stream.Context().Done():
 			return
 		default:
-			buf, op, err := wsutil.ReadClientData(rw)
+			buf, op, rsv1, err := readClientData(rw)
 			if err != nil {
 				if wserr, ok := err.(wsutil.ClosedError); ok {
 					switch wserr.Code {
@@ -208,13 +278,34 @@ func writeLoop(rw io.ReadWriter, stream client.Stream) {
 				}
 				return
 			}
-			switch op {
-			default:
-				// not relevant
-				continue
-			case ws.OpText, ws.OpBinary:
-				break
+
+			if rsv1 {
+				if dr == nil {
+					if logger.V(logger.ErrorLevel) {
+						logger.Error(stream.Context(), "received a compressed frame but permessage-deflate was not negotiated")
+					}
+					return
+				}
+				buf, err = dr.decompress(buf)
+				if err != nil {
+					if logger.V(logger.ErrorLevel) {
+						logger.Error(stream.Context(), err.Error())
+					}
+					return
+				}
+			}
+
+			if subCodec != nil {
+				decoded, err := subCodec.Decode(buf, op)
+				if err != nil {
+					if logger.V(logger.ErrorLevel) {
+						logger.Error(stream.Context(), err.Error())
+					}
+					return
+				}
+				buf = decoded
 			}
+
 			// send to backend
 			// default to trying json
 			// if the extracted payload isn't empty lets use it
@@ -234,7 +325,12 @@ func isStream(r *http.Request, srv *api.Service) bool {
 	if !isWebSocket(r) {
 		return false
 	}
-	// check if the endpoint supports streaming
+	return isEndpointStream(srv)
+}
+
+// isEndpointStream checks if the endpoint matched for this request
+// supports streaming, regardless of the transport used to reach it.
+func isEndpointStream(srv *api.Service) bool {
 	for _, service := range srv.Services {
 		for _, ep := range service.Endpoints {
 			// skip if it doesn't match the name
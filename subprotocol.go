@@ -0,0 +1,106 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/unistack-org/micro/v3/api"
+	"github.com/unistack-org/micro/v3/logger"
+)
+
+// SubprotocolCodec translates between a negotiated Sec-WebSocket-Protocol
+// framing (e.g. channel.k8s.io) and the codec.Frame bytes sent to and
+// read from the backend stream.
+type SubprotocolCodec interface {
+	// Encode turns a backend frame into the bytes and opcode to write on
+	// the wire for the negotiated subprotocol.
+	Encode(op ws.OpCode, payload []byte) ([]byte, ws.OpCode, error)
+	// Decode turns bytes read off the wire back into a backend frame.
+	Decode(buf []byte, op ws.OpCode) ([]byte, error)
+}
+
+// endpointSubprotocol returns the ws_subprotocol metadata value declared
+// on the endpoint matched for this request (e.g. "channel.k8s.io"), or ""
+// if the endpoint didn't declare one, mirroring isEndpointStream's and
+// patchGetEndpoint's lookup. serveWebsocket only lets a client negotiate
+// a registered SubprotocolCodec when it matches this value, so a client
+// can't drive an arbitrary endpoint through a codec it was never meant
+// to speak just by asking for it.
+func endpointSubprotocol(srv *api.Service) string {
+	for _, service := range srv.Services {
+		for _, ep := range service.Endpoints {
+			if ep.Name != srv.Endpoint.Name {
+				continue
+			}
+			return ep.Metadata["ws_subprotocol"]
+		}
+	}
+	return ""
+}
+
+// errRouteChanged is returned by reauthorize and only ever logged by
+// reauthLoop; it never leaves this package.
+var errRouteChanged = errors.New("route changed on reauthorization")
+
+// reauthLoop re-runs authorization for a long-lived websocket connection
+// every opts.ReauthInterval. If it fails or the route changes, it sends
+// a policy-violation close frame and signals stop so serveWebsocket's
+// read loop can tear the connection down. wmu guards rw against
+// concurrent writes from serveWebsocket's main loop.
+func reauthLoop(ctx context.Context, rw io.Writer, wmu *sync.Mutex, r *http.Request, service *api.Service, opts Options, stop chan struct{}) {
+	ticker := time.NewTicker(opts.ReauthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := reauthorize(r, service, opts); err != nil {
+				if logger.V(logger.ErrorLevel) {
+					logger.Error(ctx, err.Error())
+				}
+				closeFrame := ws.NewCloseFrame(ws.NewCloseFrameBody(ws.StatusPolicyViolation, "reauthorization failed"))
+				wmu.Lock()
+				werr := ws.WriteFrame(rw, closeFrame)
+				if f, ok := rw.(interface{ Flush() error }); werr == nil && ok {
+					werr = f.Flush()
+				}
+				wmu.Unlock()
+				if werr != nil {
+					if logger.V(logger.ErrorLevel) {
+						logger.Error(ctx, werr.Error())
+					}
+				}
+				close(stop)
+				return
+			}
+		}
+	}
+}
+
+// reauthorize re-checks that r is still authorized to use service. With
+// no override it re-runs Router.Route and requires the endpoint to stay
+// the same; WithReauthFunc can replace this with an auth-specific check.
+func reauthorize(r *http.Request, service *api.Service, opts Options) error {
+	if opts.ReauthFunc != nil {
+		return opts.ReauthFunc(r)
+	}
+	if opts.Router == nil {
+		return nil
+	}
+
+	current, err := opts.Router.Route(r)
+	if err != nil {
+		return err
+	}
+	if current.Endpoint == nil || service.Endpoint == nil || current.Endpoint.Name != service.Endpoint.Name {
+		return errRouteChanged
+	}
+	return nil
+}